@@ -0,0 +1,237 @@
+// Command roam-export walks a parsed RoamGraph and emits a Graphviz DOT
+// file representing blocks and pages as nodes, with block/refs,
+// block/parents and block/children relationships as edges, so a graph
+// can be visualized with `dot`/`neato` without a separate tool.
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/Vbitz/go-roam/roamgraph"
+)
+
+var (
+	inputFile      = flag.String("input", "", "A EDN format file exported from Roam Research to parse.")
+	outputFile     = flag.String("output", "graph.dot", "Path to write the DOT file to. A .gz suffix gzips the output.")
+	rootUid        = flag.String("rootUid", "", "If set, only export the subgraph reachable from this block uid.")
+	depth          = flag.Int("depth", -1, "Max BFS depth from -rootUid over refs/children. -1 means unlimited.")
+	pagesOnly      = flag.Bool("pagesOnly", false, "Only export page nodes and the links between them.")
+	includeOrphans = flag.Bool("includeOrphans", true, "Include nodes with no edges in the exported graph.")
+	labelLength    = flag.Int("labelLength", 40, "Max length of a block's text in its node label.")
+)
+
+func main() {
+	flag.Parse()
+
+	f, err := os.Open(*inputFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	graph, err := roamgraph.ParseGraph(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	blocks := selectBlocks(graph)
+
+	out, err := createOutput(*outputFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	if err := writeDot(w, blocks); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// selectBlocks returns the set of blocks to export, honouring -rootUid,
+// -depth and -pagesOnly.
+func selectBlocks(graph *roamgraph.RoamGraph) map[string]*roamgraph.Block {
+	blocks := make(map[string]*roamgraph.Block)
+
+	if *rootUid == "" {
+		for uid, block := range graph.Blocks {
+			blocks[uid] = block
+		}
+	} else {
+		root, ok := graph.Blocks[*rootUid]
+		if !ok {
+			log.Fatalf("no block with uid %q", *rootUid)
+		}
+		blocks = bfs(root, *depth)
+	}
+
+	if *pagesOnly {
+		for uid, block := range blocks {
+			if !block.IsPage() {
+				delete(blocks, uid)
+			}
+		}
+	}
+
+	return blocks
+}
+
+// bfs walks refs and children outward from root up to maxDepth (-1 for
+// unlimited) and returns the visited blocks keyed by uid.
+func bfs(root *roamgraph.Block, maxDepth int) map[string]*roamgraph.Block {
+	visited := map[string]*roamgraph.Block{root.Uid(): root}
+
+	type frontierEntry struct {
+		block *roamgraph.Block
+		depth int
+	}
+
+	queue := []frontierEntry{{root, 0}}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		if maxDepth >= 0 && cur.depth >= maxDepth {
+			continue
+		}
+
+		var next []*roamgraph.Block
+		next = append(next, cur.block.OutgoingRefs()...)
+		next = append(next, cur.block.Children()...)
+
+		for _, n := range next {
+			if _, ok := visited[n.Uid()]; ok {
+				continue
+			}
+			visited[n.Uid()] = n
+			queue = append(queue, frontierEntry{n, cur.depth + 1})
+		}
+	}
+
+	return visited
+}
+
+func createOutput(path string) (io.WriteCloser, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(path, ".gz") {
+		return gzipWriteCloser{gzip.NewWriter(f), f}, nil
+	}
+
+	return f, nil
+}
+
+// gzipWriteCloser closes both the gzip writer and the underlying file.
+type gzipWriteCloser struct {
+	*gzip.Writer
+	f *os.File
+}
+
+func (g gzipWriteCloser) Close() error {
+	if err := g.Writer.Close(); err != nil {
+		return err
+	}
+	return g.f.Close()
+}
+
+func nodeLabel(block *roamgraph.Block) string {
+	text := block.Text()
+	if text == "" {
+		// Page blocks routinely have no block/string, only a title.
+		text = block.Title()
+	}
+
+	text = roamgraph.ProcessText(text, "")
+	text = strings.ReplaceAll(text, "\"", "'")
+	if runes := []rune(text); len(runes) > *labelLength {
+		text = string(runes[:*labelLength]) + "..."
+	}
+	return text
+}
+
+func writeDot(w io.Writer, blocks map[string]*roamgraph.Block) error {
+	edges := make(map[string]bool)
+	hasEdge := make(map[string]bool)
+
+	addEdge := func(from, to, style, color string) string {
+		key := fmt.Sprintf("%s->%s[%s]", from, to, style)
+		if edges[key] {
+			return ""
+		}
+		edges[key] = true
+		hasEdge[from] = true
+		hasEdge[to] = true
+		return fmt.Sprintf("  %q -> %q [style=%s, color=%s];\n", from, to, style, color)
+	}
+
+	var body strings.Builder
+
+	for uid, block := range blocks {
+		for _, ref := range block.OutgoingRefs() {
+			if _, ok := blocks[ref.Uid()]; !ok {
+				continue
+			}
+			body.WriteString(addEdge(uid, ref.Uid(), "solid", "red"))
+		}
+
+		if !*pagesOnly {
+			for _, child := range block.Children() {
+				if _, ok := blocks[child.Uid()]; !ok {
+					continue
+				}
+				body.WriteString(addEdge(uid, child.Uid(), "solid", "black"))
+			}
+
+			for _, parent := range block.Parents() {
+				if _, ok := blocks[parent.Uid()]; !ok {
+					continue
+				}
+				body.WriteString(addEdge(uid, parent.Uid(), "dashed", "gray"))
+			}
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "digraph roam {\n  rankdir=LR;\n  node [fontsize=10];\n\n"); err != nil {
+		return err
+	}
+
+	for uid, block := range blocks {
+		if !*includeOrphans && !hasEdge[uid] {
+			continue
+		}
+
+		shape := "ellipse"
+		if block.IsPage() {
+			shape = "box"
+		}
+
+		if _, err := fmt.Fprintf(w, "  %q [label=%q, shape=%s];\n", uid, nodeLabel(block), shape); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprint(w, "\n"); err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, body.String()); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprint(w, "}\n")
+	return err
+}
@@ -0,0 +1,115 @@
+// Command roam-server parses a Roam Research EDN export once at startup
+// and serves it over a GraphQL API, so downstream tools can query the
+// graph interactively instead of re-parsing it for every request.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	"github.com/graph-gophers/graphql-go/relay"
+
+	"github.com/Vbitz/go-roam/roamgraph"
+)
+
+var (
+	inputFile = flag.String("input", "", "A EDN format file exported from Roam Research to parse. Optional if -db already has a cached graph.")
+	dbPath    = flag.String("db", "", "Path to an embedded store caching the parsed graph across restarts. Empty disables caching.")
+	rebuild   = flag.Bool("rebuild", false, "Discard any cached store at -db and fully reparse -input.")
+	addr      = flag.String("addr", ":8080", "Address to listen on.")
+	graphiql  = flag.Bool("graphiql", true, "Serve the GraphiQL playground at /.")
+)
+
+func main() {
+	flag.Parse()
+
+	graph, err := loadGraph()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer graph.Close()
+
+	schema := graphql.MustParseSchema(schemaSDL, &resolver{graph: graph})
+
+	http.Handle("/graphql", &relay.Handler{Schema: schema})
+	if *graphiql {
+		http.HandleFunc("/", serveGraphiQL)
+	}
+
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+// loadGraph builds the RoamGraph to serve, preferring the cached store at
+// -db when set so a restart doesn't have to re-read the full EDN export.
+func loadGraph() (*roamgraph.RoamGraph, error) {
+	var graph *roamgraph.RoamGraph
+
+	if *dbPath != "" {
+		if *rebuild {
+			if err := os.Remove(*dbPath); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+
+		g, err := roamgraph.OpenGraph(*dbPath)
+		if err != nil {
+			return nil, err
+		}
+		graph = g
+	}
+
+	if *inputFile == "" {
+		if graph == nil {
+			return nil, fmt.Errorf("either -input or -db must be set")
+		}
+		return graph, nil
+	}
+
+	f, err := os.Open(*inputFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if graph == nil {
+		return roamgraph.ParseGraph(f)
+	}
+
+	if err := graph.Apply(f); err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+func serveGraphiQL(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(graphiqlPage))
+}
+
+const graphiqlPage = `<!DOCTYPE html>
+<html>
+<head>
+	<title>go-roam GraphiQL</title>
+	<link href="https://unpkg.com/graphiql/graphiql.min.css" rel="stylesheet" />
+</head>
+<body style="margin: 0;">
+	<div id="graphiql" style="height: 100vh;"></div>
+	<script src="https://unpkg.com/react/umd/react.production.min.js"></script>
+	<script src="https://unpkg.com/react-dom/umd/react-dom.production.min.js"></script>
+	<script src="https://unpkg.com/graphiql/graphiql.min.js"></script>
+	<script>
+		ReactDOM.render(
+			React.createElement(GraphiQL, {
+				fetcher: GraphiQL.createFetcher({ url: '/graphql' }),
+			}),
+			document.getElementById('graphiql'),
+		);
+	</script>
+</body>
+</html>
+`
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Vbitz/go-roam/roamgraph"
+)
+
+// resolver is the GraphQL root resolver. It holds no state beyond the
+// parsed graph, since roamgraph.RoamGraph is read-only once built.
+type resolver struct {
+	graph *roamgraph.RoamGraph
+}
+
+func (r *resolver) Block(args struct{ Uid string }) *blockResolver {
+	block, ok := r.graph.Blocks[args.Uid]
+	if !ok {
+		return nil
+	}
+	return &blockResolver{block}
+}
+
+func (r *resolver) Page(args struct{ Title string }) *pageResolver {
+	page, ok := r.graph.Pages[args.Title]
+	if !ok {
+		return nil
+	}
+	return &pageResolver{page}
+}
+
+func (r *resolver) BlocksWithTag(args struct{ Name string }) []*blockResolver {
+	var ret []*blockResolver
+	for _, block := range r.graph.BlocksWithTag(args.Name) {
+		ret = append(ret, &blockResolver{block})
+	}
+	return ret
+}
+
+type blockResolver struct {
+	block *roamgraph.Block
+}
+
+func (b *blockResolver) Uid() string  { return b.block.Uid() }
+func (b *blockResolver) Text() string { return b.block.Text() }
+func (b *blockResolver) Order() int32 { return int32(b.block.Order()) }
+
+func (b *blockResolver) OutgoingRefs() []*refResolver {
+	return refResolvers(b.block.OutgoingRefs())
+}
+
+func (b *blockResolver) IncomingRefs() []*refResolver {
+	return refResolvers(b.block.IncomingRefs())
+}
+
+func (b *blockResolver) Parents() []*refResolver {
+	return refResolvers(b.block.Parents())
+}
+
+func (b *blockResolver) Children() []*refResolver {
+	return refResolvers(b.block.Children())
+}
+
+func (b *blockResolver) Values() []*valueResolver {
+	var ret []*valueResolver
+	for _, value := range b.block.Values() {
+		ret = append(ret, &valueResolver{value})
+	}
+	return ret
+}
+
+type pageResolver struct {
+	page *roamgraph.Page
+}
+
+func (p *pageResolver) Title() string         { return p.page.Title }
+func (p *pageResolver) Block() *blockResolver { return &blockResolver{p.page.Block()} }
+
+type refResolver struct {
+	block *roamgraph.Block
+}
+
+func refResolvers(blocks []*roamgraph.Block) []*refResolver {
+	var ret []*refResolver
+	for _, block := range blocks {
+		ret = append(ret, &refResolver{block})
+	}
+	return ret
+}
+
+func (r *refResolver) Uid() string           { return r.block.Uid() }
+func (r *refResolver) Block() *blockResolver { return &blockResolver{r.block} }
+
+type valueResolver struct {
+	value roamgraph.Value
+}
+
+func (v *valueResolver) Attribute() string { return string(v.value.Attribute) }
+func (v *valueResolver) Value() string     { return fmt.Sprintf("%v", v.value.Value) }
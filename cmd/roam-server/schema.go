@@ -0,0 +1,43 @@
+package main
+
+const schemaSDL = `
+	schema {
+		query: Query
+	}
+
+	type Query {
+		block(uid: String!): Block
+		page(title: String!): Page
+		blocksWithTag(name: String!): [Block!]!
+	}
+
+	type Block {
+		uid: String!
+		text: String!
+		order: Int!
+		outgoingRefs: [Ref!]!
+		incomingRefs: [Ref!]!
+		parents: [Ref!]!
+		children: [Ref!]!
+		values: [Value!]!
+	}
+
+	type Page {
+		title: String!
+		block: Block!
+	}
+
+	# Ref is an edge from one block to another, e.g. a block/refs or
+	# block/parents link.
+	type Ref {
+		uid: String!
+		block: Block!
+	}
+
+	# Value is a single raw EDN datom attached to a block's entity, keyed
+	# by its attribute keyword.
+	type Value {
+		attribute: String!
+		value: String!
+	}
+`
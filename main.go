@@ -1,323 +1,150 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path"
 	"sort"
 	"strings"
 
-	"olympos.io/encoding/edn"
+	"github.com/Vbitz/go-roam/roamgraph"
+	"github.com/Vbitz/go-roam/roamquery"
 )
 
 var (
-	inputFile  = flag.String("input", "", "A EDN format file exported from Roam Research to parse.")
+	inputFile  = flag.String("input", "", "A EDN format file exported from Roam Research to parse. Optional if -db already has a cached graph.")
+	dbPath     = flag.String("db", "", "Path to an embedded store caching the parsed graph across restarts. Empty disables caching.")
+	rebuild    = flag.Bool("rebuild", false, "Discard any cached store at -db and fully reparse -input.")
 	publishTag = flag.String("publishTag", "publish", "The tag in Roam Research to control extracting posts.")
+	scriptFile = flag.String("script", "", "A JavaScript file to run against the graph instead of the built-in publish flow.")
+	timeout    = flag.Duration("timeout", 0, "Abort -script after this long. 0 means no timeout.")
 )
 
-type RoamSchema struct {
-	Cardinality edn.Keyword `edn:"db/cardinality"`
-	ValueType   edn.Keyword `edn:"db/valueType"`
-	Unique      edn.Keyword `edn:"db/unique"`
-}
-
-type EntityId int64
-type TransactionId int64
-
-type Value struct {
-	Attribute     edn.Keyword
-	Value         any
-	TransactionId TransactionId
-}
-
-func (v Value) String() string {
-	return fmt.Sprintf("%s: %+v", v.Attribute, v.Value)
-}
-
-type Entity struct {
-	graph   *RoamGraph
-	blockId string
-
-	Id     EntityId
-	Values []Value
-}
-
-func (e Entity) Block() *Block {
-	return e.graph.Blocks[e.blockId]
-}
-
-func (e Entity) String() string {
-	return fmt.Sprintf("{%v: %+v}", e.Id, e.Values)
-}
-
-type Block struct {
-	graph *RoamGraph
-	ent   *Entity
-
-	Id           string
-	incomingRefs []*Entity
-	children     []*Entity
-}
-
-func (b Block) String() string {
-	return b.Id
-}
-
-func (b Block) Attr(attr edn.Keyword) []any {
-	var ret []any
-	for _, value := range b.ent.Values {
-		if value.Attribute == attr {
-			ret = append(ret, value.Value)
-		}
-	}
-	return ret
-}
-
-func (b Block) Uid() string {
-	uid := b.Attr(edn.Keyword("block/uid"))
-	return uid[0].(string)
-}
-
-func (b Block) Text() string {
-	uid := b.Attr(edn.Keyword("block/string"))
-	return uid[0].(string)
-}
-
-func (b Block) Order() int64 {
-	uid := b.Attr(edn.Keyword("block/order"))
-	return uid[0].(int64)
-}
-
-func (b Block) Parents() []*Block {
-	var ret []*Block
-
-	for _, blockId := range b.Attr("block/parents") {
-		ent := b.graph.Entities[EntityId(blockId.(int64))]
-		ret = append(ret, ent.Block())
-	}
+type documentNode struct {
+	block *roamgraph.Block
 
-	return ret
+	id       string
+	order    int
+	text     string
+	children []*documentNode
 }
 
-func (b Block) OutgoingRefs() []*Block {
-	var ret []*Block
-
-	for _, blockId := range b.Attr("block/refs") {
-		ent := b.graph.Entities[EntityId(blockId.(int64))]
-		ret = append(ret, ent.Block())
-	}
+func sortChildren(children []*documentNode) []*documentNode {
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].order < children[j].order
+	})
 
-	return ret
+	return children
 }
 
-func (b Block) IncomingRefs() []*Block {
-	var ret []*Block
+func renderMarkdown(node *documentNode, prefix string) string {
+	ret := ""
 
-	for _, block := range b.incomingRefs {
-		ret = append(ret, block.Block())
-	}
+	text := roamgraph.ProcessText(node.text, prefix)
 
-	return ret
-}
+	ret += fmt.Sprintf("%s- %s\n", prefix, text)
 
-func (b Block) Children() []*Block {
-	var ret []*Block
+	node.children = sortChildren(node.children)
 
-	for _, block := range b.children {
-		ret = append(ret, block.Block())
+	for _, child := range node.children {
+		ret += renderMarkdown(child, prefix+"  ")
 	}
 
 	return ret
 }
 
-type Page struct {
-	graph *RoamGraph
-
-	blockId string
-}
-
-func (p Page) Block() *Block {
-	return p.graph.Blocks[p.blockId]
-}
-
-type RoamGraph struct {
-	Schema    map[edn.Keyword]RoamSchema `edn:"schema"`
-	RawDatoms [][]any                    `edn:"datoms"`
-	Entities  map[EntityId]*Entity
-	Blocks    map[string]*Block
-	Pages     map[string]*Page
-}
-
-func ParseGraph(r io.Reader) (*RoamGraph, error) {
-	var _graph RoamGraph
+func main() {
+	flag.Parse()
 
-	content, err := io.ReadAll(r)
+	graph, err := loadGraph()
 	if err != nil {
-		return nil, err
+		log.Fatal(err)
 	}
+	defer graph.Close()
 
-	contentS := strings.TrimPrefix(string(content), "#datascript/DB ")
-
-	err = edn.UnmarshalString(contentS, &_graph)
-	if err != nil {
-		return nil, err
+	if *scriptFile != "" {
+		runScript(graph)
+		return
 	}
 
-	graph := &_graph
-
-	graph.Entities = make(map[EntityId]*Entity)
-	graph.Blocks = make(map[string]*Block)
-	graph.Pages = make(map[string]*Page)
+	runPublish(graph)
+}
 
-	deferredRefs := make(map[EntityId][]*Entity)
-	deferredChildren := make(map[EntityId][]*Entity)
+// loadGraph builds the RoamGraph to run against, preferring the cached
+// store at -db when set so a restart doesn't have to re-read the full
+// EDN export.
+func loadGraph() (*roamgraph.RoamGraph, error) {
+	var graph *roamgraph.RoamGraph
 
-	for _, datom := range graph.RawDatoms {
-		if len(datom) != 4 {
-			return nil, fmt.Errorf("can't parse datom %+v", datom)
+	if *dbPath != "" {
+		if *rebuild {
+			if err := os.Remove(*dbPath); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
 		}
 
-		entityId := EntityId(datom[0].(int64))
-		attribute := datom[1].(edn.Keyword)
-		value := datom[2]
-		transactionId := TransactionId(datom[3].(int64))
-
-		if _, ok := graph.Entities[entityId]; !ok {
-			graph.Entities[entityId] = &Entity{graph: graph, Id: entityId}
+		g, err := roamgraph.OpenGraph(*dbPath)
+		if err != nil {
+			return nil, err
 		}
+		graph = g
+	}
 
-		entity := graph.Entities[entityId]
-
-		entity.Values = append(entity.Values, Value{
-			Attribute:     attribute,
-			Value:         value,
-			TransactionId: transactionId,
-		})
-
-		if attribute == edn.Keyword("block/uid") {
-			if _, ok := graph.Blocks[value.(string)]; !ok {
-				graph.Blocks[value.(string)] = &Block{
-					graph: graph,
-					ent:   entity,
-					Id:    value.(string),
-				}
-			}
-			graph.Entities[entityId].blockId = value.(string)
-		} else if attribute == edn.Keyword("node/title") {
-			graph.Pages[value.(string)] = &Page{
-				graph:   graph,
-				blockId: graph.Entities[entityId].blockId,
-			}
-		} else if attribute == edn.Keyword("block/parents") {
-			target := EntityId(value.(int64))
-
-			if _, ok := deferredChildren[target]; !ok {
-				deferredChildren[target] = []*Entity{}
-			}
-			deferredChildren[target] = append(deferredChildren[target], entity)
-		} else if attribute == edn.Keyword("block/refs") {
-			target := EntityId(value.(int64))
-
-			if _, ok := deferredRefs[target]; !ok {
-				deferredRefs[target] = []*Entity{}
-			}
-			deferredRefs[target] = append(deferredRefs[target], entity)
+	if *inputFile == "" {
+		if graph == nil {
+			return nil, fmt.Errorf("either -input or -db must be set")
 		}
+		return graph, nil
 	}
 
-	for target, incomingRefs := range deferredRefs {
-		entity := graph.Entities[target]
-
-		block := graph.Blocks[entity.blockId]
-
-		block.incomingRefs = append(block.incomingRefs, incomingRefs...)
+	f, err := os.Open(*inputFile)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
 
-	for target, children := range deferredChildren {
-		entity := graph.Entities[target]
-
-		block := graph.Blocks[entity.blockId]
-
-		block.children = append(block.children, children...)
+	if graph == nil {
+		return roamgraph.ParseGraph(f)
 	}
 
+	if err := graph.Apply(f); err != nil {
+		return nil, err
+	}
 	return graph, nil
 }
 
-type documentNode struct {
-	block *Block
-
-	id       string
-	order    int
-	text     string
-	children []*documentNode
-}
-
-func sortChildren(children []*documentNode) []*documentNode {
-	sort.Slice(children, func(i, j int) bool {
-		return children[i].order < children[j].order
-	})
-
-	return children
-}
-
-func processText(text string, prefix string) string {
-	depth := 0
-	out := ""
-	for _, c := range text {
-		if c == '[' {
-			depth += 1
-			if depth == 2 {
-				out += "_"
-			}
-		} else if c == ']' {
-			depth -= 1
-			if depth == 0 {
-				out += "_"
-			}
-		} else if c == '\n' {
-			out += "\n" + prefix
-		} else {
-			out += string(c)
-		}
+// runScript runs -script against graph and writes the files it returns
+// under output/.
+func runScript(graph *roamgraph.RoamGraph) {
+	source, err := os.ReadFile(*scriptFile)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	return out
-}
-
-func renderMarkdown(node *documentNode, prefix string) string {
-	ret := ""
-
-	text := processText(node.text, prefix)
-
-	ret += fmt.Sprintf("%s- %s\n", prefix, text)
-
-	node.children = sortChildren(node.children)
-
-	for _, child := range node.children {
-		ret += renderMarkdown(child, prefix+"  ")
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
 	}
 
-	return ret
-}
-
-func main() {
-	flag.Parse()
-
-	f, err := os.Open(*inputFile)
+	files, err := roamquery.Run(ctx, graph, string(source))
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer f.Close()
 
-	graph, err := ParseGraph(f)
-	if err != nil {
-		log.Fatal(err)
+	for _, file := range files {
+		err := os.WriteFile(path.Join("output", file.Filename), []byte(file.Contents), os.ModePerm)
+		if err != nil {
+			log.Fatalf("failed to write file: %v", err)
+		}
 	}
+}
 
+func runPublish(graph *roamgraph.RoamGraph) {
 	publishPage := graph.Pages[*publishTag].Block()
 
 	publishPrefix := fmt.Sprintf("#%s ", *publishTag)
@@ -367,7 +194,7 @@ func main() {
 
 		markdown := ""
 
-		markdown += fmt.Sprintf("# %s\n\n", processText(root.text, ""))
+		markdown += fmt.Sprintf("# %s\n\n", roamgraph.ProcessText(root.text, ""))
 
 		sortChildren(root.children)
 
@@ -0,0 +1,85 @@
+package roamgraph
+
+import (
+	"fmt"
+
+	"olympos.io/encoding/edn"
+)
+
+// ErrorCode classifies what went wrong while applying an EDN export, so
+// callers can branch on the failure without parsing Message strings.
+type ErrorCode string
+
+const (
+	// EBadSchema means the top-level EDN document couldn't be decoded
+	// at all, e.g. it isn't a Roam export or was truncated mid-download.
+	EBadSchema ErrorCode = "EBADSCHEMA"
+	// EBadDatom means a datom didn't have the expected
+	// [entity attribute value tx] shape.
+	EBadDatom ErrorCode = "EBADDATOM"
+	// EBadValue means a datom field decoded to an unexpected EDN type,
+	// e.g. a non-integer entity id.
+	EBadValue ErrorCode = "EBADVALUE"
+	// EMissingAttr means an entity is missing an attribute required to
+	// resolve it into a Block, most commonly block/uid.
+	EMissingAttr ErrorCode = "EMISSINGATTR"
+	// EUnknownRef means a block/refs or block/parents datom points at
+	// an entity id that was never itself defined.
+	EUnknownRef ErrorCode = "EUNKNOWNREF"
+)
+
+// ErrorDetails carries the location context for a ParseError: where in
+// the datom stream it happened and what it was about.
+type ErrorDetails struct {
+	DatomIndex int
+	EntityId   EntityId
+	// Attribute is the datom attribute being processed when the error
+	// occurred, if any, e.g. block/uid or block/refs.
+	Attribute edn.Keyword
+	Snippet   string
+}
+
+// ParseError is returned by ParseGraph/Apply for any malformed input,
+// in place of the fmt.Errorf/log.Fatal/panic a caller would otherwise
+// have to guard against by hand.
+type ParseError struct {
+	Code ErrorCode
+	// Message is a human-readable description of what failed.
+	Message string
+	// Minor explains the likely cause, for display under Message.
+	Minor   string
+	Details ErrorDetails
+	// Cause is the underlying error, if any, e.g. from the EDN decoder.
+	Cause error
+}
+
+func (e *ParseError) Error() string {
+	if e.Minor == "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("%s: %s (%s)", e.Code, e.Message, e.Minor)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Cause
+}
+
+// Is makes errors.Is(err, ErrBadDatom) (and friends) match any
+// ParseError with that code, regardless of its other fields.
+func (e *ParseError) Is(target error) bool {
+	other, ok := target.(*ParseError)
+	if !ok {
+		return false
+	}
+	return other.Code == e.Code
+}
+
+// Sentinel ParseErrors for use with errors.Is, e.g.
+// errors.Is(err, roamgraph.ErrUnknownRef).
+var (
+	ErrBadSchema   = &ParseError{Code: EBadSchema}
+	ErrBadDatom    = &ParseError{Code: EBadDatom}
+	ErrBadValue    = &ParseError{Code: EBadValue}
+	ErrMissingAttr = &ParseError{Code: EMissingAttr}
+	ErrUnknownRef  = &ParseError{Code: EUnknownRef}
+)
@@ -0,0 +1,552 @@
+// Package roamgraph parses a Roam Research EDN export into an in-memory
+// graph of entities, blocks and pages, and exposes navigation helpers
+// (refs, parents, children) over that graph.
+package roamgraph
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"olympos.io/encoding/edn"
+)
+
+type RoamSchema struct {
+	Cardinality edn.Keyword `edn:"db/cardinality"`
+	ValueType   edn.Keyword `edn:"db/valueType"`
+	Unique      edn.Keyword `edn:"db/unique"`
+}
+
+type EntityId int64
+type TransactionId int64
+
+type Value struct {
+	Attribute     edn.Keyword
+	Value         any
+	TransactionId TransactionId
+}
+
+func (v Value) String() string {
+	return fmt.Sprintf("%s: %+v", v.Attribute, v.Value)
+}
+
+type Entity struct {
+	graph   *RoamGraph
+	blockId string
+
+	Id     EntityId
+	Values []Value
+}
+
+func (e Entity) Block() *Block {
+	return e.graph.Blocks[e.blockId]
+}
+
+func (e Entity) String() string {
+	return fmt.Sprintf("{%v: %+v}", e.Id, e.Values)
+}
+
+type Block struct {
+	graph *RoamGraph
+	ent   *Entity
+
+	Id           string
+	incomingRefs []*Entity
+	children     []*Entity
+}
+
+func (b Block) String() string {
+	return b.Id
+}
+
+func (b Block) Attr(attr edn.Keyword) []any {
+	return valuesForAttr(b.ent.Values, attr)
+}
+
+// valuesForAttr returns the Value.Value of every entry in values whose
+// Attribute is attr.
+func valuesForAttr(values []Value, attr edn.Keyword) []any {
+	var ret []any
+	for _, value := range values {
+		if value.Attribute == attr {
+			ret = append(ret, value.Value)
+		}
+	}
+	return ret
+}
+
+// removeAttr drops every existing entry for attr from values. Apply
+// calls this before recording a newer datom for (entity, attr), so a
+// later re-Apply replaces that attribute's value(s) instead of piling
+// the new one on top of the stale one.
+func removeAttr(values []Value, attr edn.Keyword) []Value {
+	filtered := values[:0]
+	for _, value := range values {
+		if value.Attribute != attr {
+			filtered = append(filtered, value)
+		}
+	}
+	return filtered
+}
+
+// removeEntities returns list with every entity in remove filtered out,
+// preserving order. Used to retract an entity from a children/
+// incomingRefs slice when the block/parents or block/refs value that
+// put it there has been superseded.
+func removeEntities(list []*Entity, remove []*Entity) []*Entity {
+	if len(remove) == 0 {
+		return list
+	}
+
+	drop := make(map[EntityId]bool, len(remove))
+	for _, entity := range remove {
+		drop[entity.Id] = true
+	}
+
+	filtered := list[:0]
+	for _, entity := range list {
+		if !drop[entity.Id] {
+			filtered = append(filtered, entity)
+		}
+	}
+	return filtered
+}
+
+// clearedAttrKey identifies one entity's value(s) for one attribute,
+// for Apply's per-call bookkeeping of which attributes have already
+// been superseded by a newer datom.
+type clearedAttrKey struct {
+	entity    EntityId
+	attribute edn.Keyword
+}
+
+// attrString returns the first value of attr as a string, or "" if the
+// block has no such attribute or its value isn't a string. Callers that
+// hand block selections to front ends (scripting, GraphQL, export) can't
+// assume every attribute is present, so the accessors built on this
+// never panic.
+func (b Block) attrString(attr edn.Keyword) string {
+	values := b.Attr(attr)
+	if len(values) == 0 {
+		return ""
+	}
+	s, _ := values[0].(string)
+	return s
+}
+
+// Uid returns this block's uid. Every *Block reachable from a RoamGraph
+// has one, since it's what keys RoamGraph.Blocks.
+func (b Block) Uid() string {
+	return b.attrString(edn.Keyword("block/uid"))
+}
+
+// Text returns this block's block/string, or "" if it has none (e.g. a
+// page block whose export didn't carry one).
+func (b Block) Text() string {
+	return b.attrString(edn.Keyword("block/string"))
+}
+
+// Title returns this block's node/title, or "" if it isn't a page.
+func (b Block) Title() string {
+	return b.attrString(edn.Keyword("node/title"))
+}
+
+// Order returns this block's block/order, or 0 if it has none (e.g. a
+// page block, which isn't ordered among siblings).
+func (b Block) Order() int64 {
+	values := b.Attr(edn.Keyword("block/order"))
+	if len(values) == 0 {
+		return 0
+	}
+	order, _ := values[0].(int64)
+	return order
+}
+
+func (b Block) Values() []Value {
+	return b.ent.Values
+}
+
+// IsPage reports whether this block is a page, i.e. it carries a
+// node/title attribute.
+func (b Block) IsPage() bool {
+	return len(b.Attr(edn.Keyword("node/title"))) > 0
+}
+
+func (b Block) Parents() []*Block {
+	var ret []*Block
+
+	for _, blockId := range b.Attr("block/parents") {
+		ent := b.graph.Entities[EntityId(blockId.(int64))]
+		ret = append(ret, ent.Block())
+	}
+
+	return ret
+}
+
+func (b Block) OutgoingRefs() []*Block {
+	var ret []*Block
+
+	for _, blockId := range b.Attr("block/refs") {
+		ent := b.graph.Entities[EntityId(blockId.(int64))]
+		ret = append(ret, ent.Block())
+	}
+
+	return ret
+}
+
+func (b Block) IncomingRefs() []*Block {
+	var ret []*Block
+
+	for _, block := range b.incomingRefs {
+		ret = append(ret, block.Block())
+	}
+
+	return ret
+}
+
+func (b Block) Children() []*Block {
+	var ret []*Block
+
+	for _, block := range b.children {
+		ret = append(ret, block.Block())
+	}
+
+	return ret
+}
+
+type Page struct {
+	graph *RoamGraph
+
+	blockId string
+
+	Title string
+}
+
+func (p Page) Block() *Block {
+	return p.graph.Blocks[p.blockId]
+}
+
+// BlocksWithTag returns the blocks tagged with this page, i.e. the blocks
+// whose text contains a reference back to the page's block.
+func (p Page) BlocksWithTag() []*Block {
+	return p.Block().IncomingRefs()
+}
+
+type RoamGraph struct {
+	Schema   map[edn.Keyword]RoamSchema
+	Entities map[EntityId]*Entity
+	Blocks   map[string]*Block
+	Pages    map[string]*Page
+
+	// db is non-nil when the graph was opened with OpenGraph, in which
+	// case Apply also persists the entities it touches.
+	db *store
+
+	// highestTx is the transaction id of the newest datom already
+	// applied, so a later Apply call can skip datoms it has already
+	// seen instead of reprocessing the full export.
+	highestTx TransactionId
+}
+
+// BlocksWithTag returns the blocks referencing the page named by tag, or
+// nil if no such page exists.
+func (g *RoamGraph) BlocksWithTag(tag string) []*Block {
+	page, ok := g.Pages[tag]
+	if !ok {
+		return nil
+	}
+	return page.BlocksWithTag()
+}
+
+func newGraph() *RoamGraph {
+	return &RoamGraph{
+		Entities: make(map[EntityId]*Entity),
+		Blocks:   make(map[string]*Block),
+		Pages:    make(map[string]*Page),
+	}
+}
+
+// ParseGraph parses a full Roam Research EDN export into a new,
+// unpersisted RoamGraph. Use OpenGraph instead to cache the derived
+// indices across runs.
+func ParseGraph(r io.Reader) (*RoamGraph, error) {
+	graph := newGraph()
+
+	if err := graph.Apply(r); err != nil {
+		return nil, err
+	}
+
+	return graph, nil
+}
+
+type rawExport struct {
+	Schema    map[edn.Keyword]RoamSchema `edn:"schema"`
+	RawDatoms [][]any                    `edn:"datoms"`
+}
+
+// Apply merges the datoms in r into graph: datoms whose transaction id is
+// already covered by a previous Apply are skipped, and only the blocks
+// touched by newly-applied datoms have their incomingRefs/children
+// recomputed. If graph was opened with OpenGraph, the touched entities
+// are also persisted.
+func (graph *RoamGraph) Apply(r io.Reader) error {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	contentS := strings.TrimPrefix(string(content), "#datascript/DB ")
+
+	var raw rawExport
+	if err := edn.UnmarshalString(contentS, &raw); err != nil {
+		return &ParseError{
+			Code:    EBadSchema,
+			Message: "failed to parse EDN export",
+			Minor:   "the input is usually either not a Roam EDN export, or was truncated mid-download",
+			Cause:   err,
+		}
+	}
+
+	if graph.Schema == nil {
+		graph.Schema = raw.Schema
+	} else {
+		for keyword, schema := range raw.Schema {
+			graph.Schema[keyword] = schema
+		}
+	}
+
+	deferredRefs := make(map[EntityId][]*Entity)
+	deferredChildren := make(map[EntityId][]*Entity)
+	retractedRefs := make(map[EntityId][]*Entity)
+	retractedChildren := make(map[EntityId][]*Entity)
+	touched := make(map[EntityId]*Entity)
+
+	// clearedAttrs tracks which (entity, attribute) pairs this call has
+	// already superseded, so the first new datom for a pair wipes
+	// whatever that entity/attribute held from a previous Apply, while
+	// later datoms for the same pair in this same call (e.g. a
+	// multi-valued block/parents chain) keep accumulating normally.
+	clearedAttrs := make(map[clearedAttrKey]bool)
+
+	// appliedTx is the high-water-mark as of the start of this call, so
+	// datoms from an already-applied transaction are skipped even when
+	// this call's own datoms share a transaction id with each other.
+	appliedTx := graph.highestTx
+
+	for i, datom := range raw.RawDatoms {
+		if len(datom) != 4 {
+			return &ParseError{
+				Code:    EBadDatom,
+				Message: fmt.Sprintf("datom %d has %d fields, want 4", i, len(datom)),
+				Minor:   "datoms are always [entity attribute value tx]; this export may be from an incompatible schema version",
+				Details: ErrorDetails{DatomIndex: i, Snippet: fmt.Sprintf("%+v", datom)},
+			}
+		}
+
+		entityIdRaw, ok := datom[0].(int64)
+		if !ok {
+			return &ParseError{
+				Code:    EBadValue,
+				Message: fmt.Sprintf("datom %d has a non-integer entity id %#v", i, datom[0]),
+				Details: ErrorDetails{DatomIndex: i, Snippet: fmt.Sprintf("%+v", datom)},
+			}
+		}
+		entityId := EntityId(entityIdRaw)
+
+		attribute, ok := datom[1].(edn.Keyword)
+		if !ok {
+			return &ParseError{
+				Code:    EBadValue,
+				Message: fmt.Sprintf("datom %d has a non-keyword attribute %#v", i, datom[1]),
+				Details: ErrorDetails{DatomIndex: i, EntityId: entityId, Snippet: fmt.Sprintf("%+v", datom)},
+			}
+		}
+
+		value := datom[2]
+
+		transactionIdRaw, ok := datom[3].(int64)
+		if !ok {
+			return &ParseError{
+				Code:    EBadValue,
+				Message: fmt.Sprintf("datom %d has a non-integer transaction id %#v", i, datom[3]),
+				Details: ErrorDetails{DatomIndex: i, EntityId: entityId, Attribute: attribute, Snippet: fmt.Sprintf("%+v", datom)},
+			}
+		}
+		transactionId := TransactionId(transactionIdRaw)
+
+		if transactionId <= appliedTx {
+			continue
+		}
+		if transactionId > graph.highestTx {
+			graph.highestTx = transactionId
+		}
+
+		if _, ok := graph.Entities[entityId]; !ok {
+			graph.Entities[entityId] = &Entity{graph: graph, Id: entityId}
+		}
+
+		entity := graph.Entities[entityId]
+
+		key := clearedAttrKey{entityId, attribute}
+		if !clearedAttrs[key] {
+			clearedAttrs[key] = true
+
+			for _, old := range valuesForAttr(entity.Values, attribute) {
+				oldTarget, ok := old.(int64)
+				if !ok {
+					continue
+				}
+				switch attribute {
+				case edn.Keyword("block/parents"):
+					retractedChildren[EntityId(oldTarget)] = append(retractedChildren[EntityId(oldTarget)], entity)
+				case edn.Keyword("block/refs"):
+					retractedRefs[EntityId(oldTarget)] = append(retractedRefs[EntityId(oldTarget)], entity)
+				}
+			}
+
+			entity.Values = removeAttr(entity.Values, attribute)
+		}
+
+		entity.Values = append(entity.Values, Value{
+			Attribute:     attribute,
+			Value:         value,
+			TransactionId: transactionId,
+		})
+
+		touched[entityId] = entity
+
+		if attribute == edn.Keyword("block/uid") {
+			uid, ok := value.(string)
+			if !ok {
+				return &ParseError{
+					Code:    EBadValue,
+					Message: fmt.Sprintf("datom %d has a non-string block/uid %#v", i, value),
+					Details: ErrorDetails{DatomIndex: i, EntityId: entityId, Attribute: attribute, Snippet: fmt.Sprintf("%+v", datom)},
+				}
+			}
+			if _, ok := graph.Blocks[uid]; !ok {
+				graph.Blocks[uid] = &Block{
+					graph: graph,
+					ent:   entity,
+					Id:    uid,
+				}
+			}
+			entity.blockId = uid
+		} else if attribute == edn.Keyword("node/title") {
+			title, ok := value.(string)
+			if !ok {
+				return &ParseError{
+					Code:    EBadValue,
+					Message: fmt.Sprintf("datom %d has a non-string node/title %#v", i, value),
+					Details: ErrorDetails{DatomIndex: i, EntityId: entityId, Attribute: attribute, Snippet: fmt.Sprintf("%+v", datom)},
+				}
+			}
+			graph.Pages[title] = &Page{
+				graph:   graph,
+				blockId: entity.blockId,
+				Title:   title,
+			}
+		} else if attribute == edn.Keyword("block/parents") {
+			target, ok := value.(int64)
+			if !ok {
+				return &ParseError{
+					Code:    EBadValue,
+					Message: fmt.Sprintf("datom %d has a non-integer block/parents target %#v", i, value),
+					Details: ErrorDetails{DatomIndex: i, EntityId: entityId, Attribute: attribute, Snippet: fmt.Sprintf("%+v", datom)},
+				}
+			}
+			deferredChildren[EntityId(target)] = append(deferredChildren[EntityId(target)], entity)
+		} else if attribute == edn.Keyword("block/refs") {
+			target, ok := value.(int64)
+			if !ok {
+				return &ParseError{
+					Code:    EBadValue,
+					Message: fmt.Sprintf("datom %d has a non-integer block/refs target %#v", i, value),
+					Details: ErrorDetails{DatomIndex: i, EntityId: entityId, Attribute: attribute, Snippet: fmt.Sprintf("%+v", datom)},
+				}
+			}
+			deferredRefs[EntityId(target)] = append(deferredRefs[EntityId(target)], entity)
+		}
+	}
+
+	// Retractions run before additions so a block/refs or block/parents
+	// value that moved from one target to another in this same Apply
+	// ends up recorded only on its new target, not both.
+	for target, retracted := range retractedRefs {
+		if entity, ok := graph.Entities[target]; ok {
+			if block, ok := graph.Blocks[entity.blockId]; ok {
+				block.incomingRefs = removeEntities(block.incomingRefs, retracted)
+			}
+		}
+	}
+
+	for target, retracted := range retractedChildren {
+		if entity, ok := graph.Entities[target]; ok {
+			if block, ok := graph.Blocks[entity.blockId]; ok {
+				block.children = removeEntities(block.children, retracted)
+			}
+		}
+	}
+
+	for target, incomingRefs := range deferredRefs {
+		entity, ok := graph.Entities[target]
+		if !ok {
+			return &ParseError{
+				Code:    EUnknownRef,
+				Message: fmt.Sprintf("block/refs points at unknown entity %d", target),
+				Minor:   "the export may be partial, or was captured mid-transaction",
+				Details: ErrorDetails{EntityId: target, Attribute: edn.Keyword("block/refs")},
+			}
+		}
+
+		block, ok := graph.Blocks[entity.blockId]
+		if !ok {
+			return &ParseError{
+				Code:    EMissingAttr,
+				Message: fmt.Sprintf("entity %d referenced via block/refs has no block/uid", target),
+				Details: ErrorDetails{EntityId: target, Attribute: edn.Keyword("block/refs")},
+			}
+		}
+
+		block.incomingRefs = append(block.incomingRefs, incomingRefs...)
+	}
+
+	for target, children := range deferredChildren {
+		entity, ok := graph.Entities[target]
+		if !ok {
+			return &ParseError{
+				Code:    EUnknownRef,
+				Message: fmt.Sprintf("block/parents points at unknown entity %d", target),
+				Minor:   "the export may be partial, or was captured mid-transaction",
+				Details: ErrorDetails{EntityId: target, Attribute: edn.Keyword("block/parents")},
+			}
+		}
+
+		block, ok := graph.Blocks[entity.blockId]
+		if !ok {
+			return &ParseError{
+				Code:    EMissingAttr,
+				Message: fmt.Sprintf("entity %d referenced via block/parents has no block/uid", target),
+				Details: ErrorDetails{EntityId: target, Attribute: edn.Keyword("block/parents")},
+			}
+		}
+
+		block.children = append(block.children, children...)
+	}
+
+	if graph.db != nil {
+		if err := graph.db.putEntities(touched, graph.highestTx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close releases the embedded store backing graph, if any.
+func (graph *RoamGraph) Close() error {
+	if graph.db == nil {
+		return nil
+	}
+	return graph.db.Close()
+}
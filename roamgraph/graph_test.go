@@ -0,0 +1,59 @@
+package roamgraph
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestApplyIncrementalUpdate guards against re-Apply silently keeping a
+// stale block/string, block/order or block/parents value around
+// alongside the new one.
+func TestApplyIncrementalUpdate(t *testing.T) {
+	const first = `{:schema {}
+ :datoms [[1 :block/uid "page" 100]
+          [1 :node/title "Page" 100]
+          [2 :block/uid "child" 100]
+          [2 :block/string "original text" 100]
+          [2 :block/order 0 100]
+          [2 :block/parents 1 100]
+          [3 :block/uid "other-page" 100]
+          [3 :node/title "Other" 100]]}`
+
+	const second = `{:schema {}
+ :datoms [[2 :block/string "edited text" 200]
+          [2 :block/order 5 200]
+          [2 :block/parents 3 200]]}`
+
+	graph, err := ParseGraph(strings.NewReader(first))
+	if err != nil {
+		t.Fatalf("ParseGraph(first): %v", err)
+	}
+
+	if err := graph.Apply(strings.NewReader(second)); err != nil {
+		t.Fatalf("Apply(second): %v", err)
+	}
+
+	child := graph.Blocks["child"]
+
+	if got := child.Text(); got != "edited text" {
+		t.Errorf("Text() = %q, want %q", got, "edited text")
+	}
+	if got := child.Order(); got != 5 {
+		t.Errorf("Order() = %d, want 5", got)
+	}
+
+	if childUids(graph.Blocks["page"].Children()) != "" {
+		t.Errorf("old parent %q still has child after block/parents changed", "page")
+	}
+	if got := childUids(graph.Blocks["other-page"].Children()); got != "child" {
+		t.Errorf("new parent %q has children %q, want %q", "other-page", got, "child")
+	}
+}
+
+func childUids(blocks []*Block) string {
+	uids := make([]string, len(blocks))
+	for i, b := range blocks {
+		uids[i] = b.Uid()
+	}
+	return strings.Join(uids, ",")
+}
@@ -0,0 +1,213 @@
+package roamgraph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"strconv"
+
+	"go.etcd.io/bbolt"
+	"olympos.io/encoding/edn"
+)
+
+// storageSchemaVersion guards the on-disk layout of the entities bucket.
+// Bump it whenever storedEntity (or how it's interpreted) changes, so an
+// old store is rejected instead of silently misread.
+const storageSchemaVersion = 1
+
+var (
+	metaBucketName     = []byte("meta")
+	entitiesBucketName = []byte("entities")
+
+	metaVersionKey = []byte("version")
+	metaMaxTxKey   = []byte("maxTx")
+)
+
+func init() {
+	// Value.Value holds whatever concrete type olympos.io/encoding/edn
+	// decoded a datom's value as; gob needs each of those registered to
+	// round-trip the interface.
+	gob.Register(int64(0))
+	gob.Register(float64(0))
+	gob.Register("")
+	gob.Register(false)
+	gob.Register(edn.Keyword(""))
+}
+
+// storedEntity is the gob-encoded, graph-independent form of an Entity.
+type storedEntity struct {
+	Id      EntityId
+	BlockId string
+	Values  []Value
+}
+
+type store struct {
+	db *bbolt.DB
+}
+
+func (s *store) Close() error {
+	return s.db.Close()
+}
+
+// OpenGraph opens (creating if necessary) the embedded store at dbPath
+// and rebuilds a RoamGraph from whatever entities are already persisted
+// there, without re-reading any EDN. Call (*RoamGraph).Apply to bring it
+// up to date with a fresh export; only the datoms newer than what's
+// already stored will be processed.
+func OpenGraph(dbPath string) (*RoamGraph, error) {
+	db, err := bbolt.Open(dbPath, 0o600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := newGraph()
+	graph.db = &store{db: db}
+
+	var stored []storedEntity
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucketName)
+		if err != nil {
+			return err
+		}
+
+		if version := meta.Get(metaVersionKey); version == nil {
+			if err := meta.Put(metaVersionKey, encodeVersion(storageSchemaVersion)); err != nil {
+				return err
+			}
+		} else if got := decodeVersion(version); got != storageSchemaVersion {
+			return fmt.Errorf("roamgraph: store %q has schema version %d, this binary expects %d (rerun with -rebuild)", dbPath, got, storageSchemaVersion)
+		}
+
+		if maxTx := meta.Get(metaMaxTxKey); maxTx != nil {
+			graph.highestTx = TransactionId(decodeVersion(maxTx))
+		}
+
+		entities, err := tx.CreateBucketIfNotExists(entitiesBucketName)
+		if err != nil {
+			return err
+		}
+
+		return entities.ForEach(func(_, v []byte) error {
+			var e storedEntity
+			if err := gob.NewDecoder(bytes.NewReader(v)).Decode(&e); err != nil {
+				return err
+			}
+			stored = append(stored, e)
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	rebuildIndices(graph, stored)
+
+	return graph, nil
+}
+
+// rebuildIndices replays previously-persisted entities into graph's
+// Entities/Blocks/Pages maps and the derived incomingRefs/children
+// indices, without re-reading any EDN.
+func rebuildIndices(graph *RoamGraph, stored []storedEntity) {
+	for _, se := range stored {
+		graph.Entities[se.Id] = &Entity{
+			graph:   graph,
+			blockId: se.BlockId,
+			Id:      se.Id,
+			Values:  se.Values,
+		}
+	}
+
+	for _, se := range stored {
+		if se.BlockId == "" {
+			continue
+		}
+		if _, ok := graph.Blocks[se.BlockId]; !ok {
+			graph.Blocks[se.BlockId] = &Block{
+				graph: graph,
+				ent:   graph.Entities[se.Id],
+				Id:    se.BlockId,
+			}
+		}
+	}
+
+	deferredRefs := make(map[EntityId][]*Entity)
+	deferredChildren := make(map[EntityId][]*Entity)
+
+	for _, se := range stored {
+		entity := graph.Entities[se.Id]
+
+		for _, value := range se.Values {
+			switch value.Attribute {
+			case edn.Keyword("node/title"):
+				title := value.Value.(string)
+				graph.Pages[title] = &Page{graph: graph, blockId: entity.blockId, Title: title}
+			case edn.Keyword("block/parents"):
+				target := EntityId(value.Value.(int64))
+				deferredChildren[target] = append(deferredChildren[target], entity)
+			case edn.Keyword("block/refs"):
+				target := EntityId(value.Value.(int64))
+				deferredRefs[target] = append(deferredRefs[target], entity)
+			}
+		}
+	}
+
+	for target, incomingRefs := range deferredRefs {
+		entity, ok := graph.Entities[target]
+		if !ok {
+			continue
+		}
+		if block, ok := graph.Blocks[entity.blockId]; ok {
+			block.incomingRefs = append(block.incomingRefs, incomingRefs...)
+		}
+	}
+
+	for target, children := range deferredChildren {
+		entity, ok := graph.Entities[target]
+		if !ok {
+			continue
+		}
+		if block, ok := graph.Blocks[entity.blockId]; ok {
+			block.children = append(block.children, children...)
+		}
+	}
+}
+
+// putEntities persists touched and advances the stored high-water-mark
+// transaction id in a single bbolt transaction.
+func (s *store) putEntities(touched map[EntityId]*Entity, highestTx TransactionId) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		entities := tx.Bucket(entitiesBucketName)
+
+		for id, entity := range touched {
+			var buf bytes.Buffer
+			se := storedEntity{Id: entity.Id, BlockId: entity.blockId, Values: entity.Values}
+			if err := gob.NewEncoder(&buf).Encode(&se); err != nil {
+				return err
+			}
+			if err := entities.Put(entityKey(id), buf.Bytes()); err != nil {
+				return err
+			}
+		}
+
+		meta := tx.Bucket(metaBucketName)
+		return meta.Put(metaMaxTxKey, encodeVersion(uint64(highestTx)))
+	})
+}
+
+func entityKey(id EntityId) []byte {
+	return []byte(strconv.FormatInt(int64(id), 10))
+}
+
+func encodeVersion(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	return buf
+}
+
+func decodeVersion(b []byte) uint64 {
+	return binary.BigEndian.Uint64(b)
+}
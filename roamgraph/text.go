@@ -0,0 +1,28 @@
+package roamgraph
+
+// ProcessText rewrites Roam's doubled-bracket reference syntax
+// (e.g. "[[page]]") into a single underscore-delimited span, re-indenting
+// any embedded newlines with prefix.
+func ProcessText(text string, prefix string) string {
+	depth := 0
+	out := ""
+	for _, c := range text {
+		if c == '[' {
+			depth += 1
+			if depth == 2 {
+				out += "_"
+			}
+		} else if c == ']' {
+			depth -= 1
+			if depth == 0 {
+				out += "_"
+			}
+		} else if c == '\n' {
+			out += "\n" + prefix
+		} else {
+			out += string(c)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,113 @@
+package roamquery
+
+import (
+	"context"
+
+	"github.com/Vbitz/go-roam/roamgraph"
+)
+
+// hostGraph is the `graph` global exposed to scripts.
+type hostGraph struct {
+	ctx   context.Context
+	graph *roamgraph.RoamGraph
+}
+
+func newHostGraph(ctx context.Context, graph *roamgraph.RoamGraph) *hostGraph {
+	return &hostGraph{ctx: ctx, graph: graph}
+}
+
+func (h *hostGraph) Page(title string) *hostPage {
+	checkCancel(h.ctx)
+
+	page, ok := h.graph.Pages[title]
+	if !ok {
+		return nil
+	}
+	return &hostPage{h.ctx, page}
+}
+
+func (h *hostGraph) Block(uid string) *hostBlock {
+	checkCancel(h.ctx)
+
+	block, ok := h.graph.Blocks[uid]
+	if !ok {
+		return nil
+	}
+	return &hostBlock{h.ctx, block}
+}
+
+func (h *hostGraph) BlocksWithTag(tag string) []*hostBlock {
+	checkCancel(h.ctx)
+	return h.wrapBlocks(h.graph.BlocksWithTag(tag))
+}
+
+func (h *hostGraph) All() []*hostBlock {
+	checkCancel(h.ctx)
+
+	var blocks []*roamgraph.Block
+	for _, block := range h.graph.Blocks {
+		checkCancel(h.ctx)
+		blocks = append(blocks, block)
+	}
+	return h.wrapBlocks(blocks)
+}
+
+func (h *hostGraph) wrapBlocks(blocks []*roamgraph.Block) []*hostBlock {
+	var ret []*hostBlock
+	for _, block := range blocks {
+		checkCancel(h.ctx)
+		ret = append(ret, &hostBlock{h.ctx, block})
+	}
+	return ret
+}
+
+// hostBlock is the value returned for a `Block`.
+type hostBlock struct {
+	ctx   context.Context
+	block *roamgraph.Block
+}
+
+func (b *hostBlock) Uid() string  { checkCancel(b.ctx); return b.block.Uid() }
+func (b *hostBlock) Text() string { checkCancel(b.ctx); return b.block.Text() }
+
+func (b *hostBlock) Children() []*hostBlock {
+	checkCancel(b.ctx)
+	return wrapBlocks(b.ctx, b.block.Children())
+}
+
+func (b *hostBlock) OutgoingRefs() []*hostBlock {
+	checkCancel(b.ctx)
+	return wrapBlocks(b.ctx, b.block.OutgoingRefs())
+}
+
+func (b *hostBlock) IncomingRefs() []*hostBlock {
+	checkCancel(b.ctx)
+	return wrapBlocks(b.ctx, b.block.IncomingRefs())
+}
+
+func (b *hostBlock) Parents() []*hostBlock {
+	checkCancel(b.ctx)
+	return wrapBlocks(b.ctx, b.block.Parents())
+}
+
+func wrapBlocks(ctx context.Context, blocks []*roamgraph.Block) []*hostBlock {
+	var ret []*hostBlock
+	for _, block := range blocks {
+		checkCancel(ctx)
+		ret = append(ret, &hostBlock{ctx, block})
+	}
+	return ret
+}
+
+// hostPage is the value returned for a `Page`.
+type hostPage struct {
+	ctx  context.Context
+	page *roamgraph.Page
+}
+
+func (p *hostPage) Title() string { checkCancel(p.ctx); return p.page.Title }
+
+func (p *hostPage) Block() *hostBlock {
+	checkCancel(p.ctx)
+	return &hostBlock{p.ctx, p.page.Block()}
+}
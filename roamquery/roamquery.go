@@ -0,0 +1,80 @@
+// Package roamquery embeds a JavaScript runtime over a RoamGraph so users
+// can script graph traversals instead of being limited to the built-in
+// "publish tag -> markdown" flow in main.
+package roamquery
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dop251/goja"
+
+	"github.com/Vbitz/go-roam/roamgraph"
+)
+
+// OutputFile is one file a script asked the host to write, as a
+// `{filename, contents}` record.
+type OutputFile struct {
+	Filename string
+	Contents string
+}
+
+// Run executes script against graph and returns the files it produced.
+// script must evaluate to a list of {filename, contents} records.
+//
+// ctx governs cancellation: once ctx is done, any in-flight host call
+// aborts, and a background goroutine interrupts the runtime so a script
+// stuck in a pure JS loop (no host calls) is also unwound promptly.
+func Run(ctx context.Context, graph *roamgraph.RoamGraph, script string) (results []OutputFile, err error) {
+	// Host methods call straight into roamgraph, which can panic on a
+	// selection the script built from attributes the graph doesn't have
+	// (e.g. graph.page(title).block() for a page with no blocks). goja
+	// only turns that into a catchable JS exception if the script itself
+	// wraps the call in try/catch; with none, it would otherwise unwind
+	// out of vm.RunString and crash the process. Recover here so a
+	// misbehaving script fails this call, not the whole binary.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("script panicked: %v", r)
+		}
+	}()
+
+	vm := goja.New()
+	vm.SetFieldNameMapper(goja.UncapFieldNameMapper())
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			vm.Interrupt(ctx.Err())
+		case <-stop:
+		}
+	}()
+
+	if err := vm.Set("graph", newHostGraph(ctx, graph)); err != nil {
+		return nil, err
+	}
+
+	v, err := vm.RunString(script)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := vm.ExportTo(v, &results); err != nil {
+		return nil, fmt.Errorf("script must return a list of {filename, contents}: %w", err)
+	}
+
+	return results, nil
+}
+
+// checkCancel aborts the current host call if ctx has been cancelled by
+// panicking with ctx.Err(). That panic is only a catchable JS exception
+// if the script itself wraps the call in try/catch; Run recovers it
+// regardless so an uncaught cancellation can't crash the process.
+func checkCancel(ctx context.Context) {
+	if err := ctx.Err(); err != nil {
+		panic(err)
+	}
+}